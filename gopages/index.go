@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"go/doc"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// PackageIndexEntry describes a single documented package in the generated
+// site, suitable for consumption by external tools without scraping HTML.
+type PackageIndexEntry struct {
+	Path     string   `json:"path"`
+	Synopsis string   `json:"synopsis"`
+	URL      string   `json:"url"`
+	Funcs    []string `json:"funcs,omitempty"`
+	Types    []string `json:"types,omitempty"`
+	Vars     []string `json:"vars,omitempty"`
+	Consts   []string `json:"consts,omitempty"`
+}
+
+// buildPackageIndexEntries loads full type and syntax information for every
+// package under modulePackage, returning one entry per package. Callers
+// generating a workspace of multiple modules should accumulate the entries
+// from each module and write the index/sitemap once, after the last module,
+// so earlier modules aren't overwritten by later ones.
+func buildPackageIndexEntries(args Args, modulePackage string, paths []string) ([]PackageIndexEntry, error) {
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo,
+	}, modulePackage+"/...")
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]*packages.Package, len(pkgs))
+	for _, pkg := range pkgs {
+		byPath[pkg.PkgPath] = pkg
+	}
+
+	entries := make([]PackageIndexEntry, 0, len(paths))
+	for _, pkgPath := range paths {
+		pkg, ok := byPath[pkgPath]
+		if !ok {
+			continue
+		}
+		docPkg, err := doc.NewFromFiles(pkg.Fset, pkg.Syntax, pkgPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to extract doc for package %q", pkgPath)
+		}
+		entries = append(entries, PackageIndexEntry{
+			Path:     pkgPath,
+			Synopsis: doc.Synopsis(docPkg.Doc),
+			URL:      joinURL(args.BaseURL, "pkg", pkgPath) + "/",
+			Funcs:    funcNames(docPkg.Funcs),
+			Types:    typeNames(docPkg.Types),
+			Vars:     valueNames(docPkg.Vars),
+			Consts:   valueNames(docPkg.Consts),
+		})
+	}
+	return entries, nil
+}
+
+// writePackageIndex writes the accumulated entries from every module as a
+// JSON catalog ('pkg/index.json') plus a sitemap.xml at the output root.
+func writePackageIndex(args Args, entries []PackageIndexEntry) error {
+	if err := writeJSONIndex(args, entries); err != nil {
+		return err
+	}
+	return writeSitemap(args, entries)
+}
+
+func funcNames(funcs []*doc.Func) []string {
+	names := make([]string, len(funcs))
+	for i, f := range funcs {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func typeNames(types []*doc.Type) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.Name
+	}
+	return names
+}
+
+func valueNames(values []*doc.Value) []string {
+	var names []string
+	for _, v := range values {
+		names = append(names, v.Names...)
+	}
+	return names
+}
+
+// joinURL builds a site URL by joining base with one or more path elements.
+// base may be empty (site root), a root-relative path ("/docs"), or a full
+// origin ("https://example.com/docs") as required for a sitemap's absolute
+// URLs. Unlike path.Join, it never runs path.Clean over the result, so a
+// "://" in a full origin survives intact instead of collapsing to ":/".
+func joinURL(base string, elements ...string) string {
+	var b strings.Builder
+	base = strings.TrimRight(base, "/")
+	if base == "" {
+		b.WriteByte('/')
+	} else {
+		b.WriteString(base)
+		b.WriteByte('/')
+	}
+
+	var cleaned []string
+	for _, elem := range elements {
+		elem = strings.Trim(elem, "/")
+		if elem != "" {
+			cleaned = append(cleaned, elem)
+		}
+	}
+	b.WriteString(strings.Join(cleaned, "/"))
+	return b.String()
+}
+
+func writeJSONIndex(args Args, entries []PackageIndexEntry) error {
+	buf, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	indexPath := filepath.Join(args.OutputPath, "pkg", "index.json")
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(indexPath, buf, 0600)
+}
+
+// sitemapURLSet and sitemapURL model the sitemaps.org protocol, just enough
+// to list every generated package page.
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+func writeSitemap(args Args, entries []PackageIndexEntry) error {
+	urlSet := sitemapURLSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, entry := range entries {
+		urlSet.URLs = append(urlSet.URLs, sitemapURL{Loc: entry.URL})
+	}
+	buf, err := xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		return err
+	}
+	buf = append([]byte(xml.Header), buf...)
+	return ioutil.WriteFile(filepath.Join(args.OutputPath, "sitemap.xml"), buf, 0600)
+}
@@ -12,14 +12,13 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"text/template"
 
 	"github.com/pkg/errors"
-	"golang.org/x/mod/modfile"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/godoc"
-	"golang.org/x/tools/godoc/static"
 	"golang.org/x/tools/godoc/vfs"
 	"golang.org/x/tools/godoc/vfs/mapfs"
 )
@@ -29,6 +28,9 @@ type Args struct {
 	OutputPath      string
 	SiteDescription string
 	SiteTitle       string
+	ThemePath       string
+	Jobs            int
+	Incremental     bool
 }
 
 func main() {
@@ -37,6 +39,9 @@ func main() {
 	flag.StringVar(&args.BaseURL, "base", "", "Base URL to use for static assets")
 	flag.StringVar(&args.SiteTitle, "brand-title", "", "Branding title in the top left of documentation")
 	flag.StringVar(&args.SiteDescription, "brand-description", "", "Branding description in the top left of documentation")
+	flag.StringVar(&args.ThemePath, "theme", "", "Directory of files to override the built-in theme, plus optional head.html/footer.html fragments")
+	flag.IntVar(&args.Jobs, "jobs", runtime.NumCPU(), "Number of packages to scrape concurrently")
+	flag.BoolVar(&args.Incremental, "incremental", false, "Skip regenerating packages unchanged since the previous run")
 	flag.Parse()
 
 	log.SetOutput(ioutil.Discard) // disable godoc's internal logging
@@ -49,48 +54,53 @@ func main() {
 }
 
 func run(args Args) error {
-	modulePath, err := os.Getwd()
+	workDir, err := os.Getwd()
 	if err != nil {
 		return err
 	}
 
-	goMod := filepath.Join(modulePath, "go.mod")
-	if _, err := os.Stat(goMod); os.IsNotExist(err) {
-		return errors.New("go.mod not found in the current directory")
-	}
-
-	buf, err := ioutil.ReadFile(goMod)
+	modules, err := discoverModules(workDir)
 	if err != nil {
 		return err
 	}
 
-	modulePackage := modfile.ModulePath(buf)
-	if modulePackage == "" {
-		return errors.Errorf("Unable to find module package name in go.mod file: %s", goMod)
+	theme, err := loadTheme(args.ThemePath)
+	if err != nil {
+		return err
 	}
 
-	if err := os.RemoveAll(args.OutputPath); err != nil {
+	var prevManifest buildManifest
+	if args.Incremental {
+		prevManifest = loadManifest(args.OutputPath)
+	} else if err := os.RemoveAll(args.OutputPath); err != nil {
 		return err
 	}
 	if err := os.MkdirAll(args.OutputPath, 0700); err != nil {
 		return err
 	}
+	newManifest := buildManifest{
+		TemplatesHash: templatesHash(theme),
+		Packages:      make(map[string]string),
+	}
 
-	fmt.Println("Generating godoc static pages for module...", modulePackage)
+	themedFiles := theme.mergedFiles()
 
 	fs := vfs.NewNameSpace()
-	fs.Bind("/lib/godoc", mapfs.New(static.Files), "/", vfs.BindReplace)
-	modFS := vfs.OS(modulePath)
-	fs.Bind(path.Join("/src", modulePackage), modFS, "/", vfs.BindReplace)
+	fs.Bind("/lib/godoc", mapfs.New(themedFiles), "/", vfs.BindReplace)
+	for _, mod := range modules {
+		fs.Bind(path.Join("/src", mod.Path), vfs.OS(mod.Dir), "/", vfs.BindReplace)
+	}
 
 	corpus := godoc.NewCorpus(fs)
 	corpus.Init()
 
 	pres := godoc.NewPresentation(corpus)
-	readTemplates(args, pres, fs)
+	readTemplates(args, pres, fs, theme)
 
-	// Generate all static assets and save to /lib/godoc
-	for name, content := range static.Files {
+	// Generate all static assets and save to /lib/godoc. Reuses the same
+	// themedFiles the vfs was bound to, so overrides take effect in both
+	// rendered templates and the shipped copies.
+	for name, content := range themedFiles {
 		path := filepath.Join(args.OutputPath, "lib", "godoc", name)
 		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 			return err
@@ -101,8 +111,13 @@ func run(args Args) error {
 		}
 	}
 
-	// Generate main index to redirect to actual content page. Important to separate from 'lib' top-level dir.
-	err = ioutil.WriteFile(filepath.Join(args.OutputPath, "index.html"), []byte(redirect("pkg/")), 0600)
+	// Generate main index. A single module redirects straight to its content
+	// page; a workspace with multiple modules gets a landing page listing them.
+	if len(modules) == 1 {
+		err = ioutil.WriteFile(filepath.Join(args.OutputPath, "index.html"), []byte(redirect("pkg/"+modules[0].Path+"/")), 0600)
+	} else {
+		err = writeWorkspaceLandingPage(pres, args, modules)
+	}
 	if err != nil {
 		return err
 	}
@@ -123,16 +138,45 @@ Oops, this page doesn't exist.
 		return err
 	}
 
-	// For each package, generate an index page
-	paths, err := getPackagePaths(modulePackage)
-	if err != nil {
-		return err
-	}
-	for _, path := range paths {
-		err = scrapePackage(pres, modulePackage, path, filepath.Join(args.OutputPath, "pkg"))
+	// For each module, generate an index page per package, fanned out across
+	// a worker pool and skipping unchanged packages in incremental mode.
+	// The package index, sitemap and search index cover every module, so
+	// their entries are accumulated here and written once after the loop.
+	var indexEntries []PackageIndexEntry
+	searchIndex := make(SearchIndex)
+	for _, mod := range modules {
+		fmt.Println("Generating godoc static pages for module...", mod.Path)
+		paths, err := getPackagePaths(mod.Path)
+		if err != nil {
+			return err
+		}
+		if err := scrapePackages(pres, mod.Path, paths, filepath.Join(args.OutputPath, "pkg", mod.Path), args.BaseURL, args.Jobs, args.Incremental, prevManifest, newManifest); err != nil {
+			return err
+		}
+
+		modEntries, err := buildPackageIndexEntries(args, mod.Path, paths)
+		if err != nil {
+			return err
+		}
+		indexEntries = append(indexEntries, modEntries...)
+
+		modSearchIndex, err := buildSearchIndex(mod.Path, paths)
 		if err != nil {
 			return err
 		}
+		for identifier, entries := range modSearchIndex {
+			searchIndex[identifier] = append(searchIndex[identifier], entries...)
+		}
+	}
+
+	if err := writePackageIndex(args, indexEntries); err != nil {
+		return err
+	}
+	if err := writeSearchAssets(args, searchIndex); err != nil {
+		return err
+	}
+	if err := saveManifest(args.OutputPath, newManifest); err != nil {
+		return err
 	}
 	fmt.Println("Done!")
 	return nil
@@ -165,9 +209,9 @@ func genericPage(pres *godoc.Presentation, title, body string) ([]byte, error) {
 	})
 }
 
-func scrapePackage(pres *godoc.Presentation, moduleRoot, packagePath, outputPath string) error {
+func packageOutputPath(moduleRoot, packagePath, outputPath string) (string, error) {
 	if moduleRoot != packagePath && !strings.HasPrefix(packagePath, moduleRoot+"/") {
-		return errors.Errorf("Package path %q must be rooted by module: %q", packagePath, moduleRoot)
+		return "", errors.Errorf("Package path %q must be rooted by module: %q", packagePath, moduleRoot)
 	}
 	var packageRelPath string
 	if moduleRoot != packagePath {
@@ -178,32 +222,48 @@ func scrapePackage(pres *godoc.Presentation, moduleRoot, packagePath, outputPath
 		outputComponents = append(outputComponents, strings.Split(packageRelPath, "/")...)
 	}
 	outputComponents = append(outputComponents, "index.html")
-	outputPath = filepath.Join(outputComponents...)
+	return filepath.Join(outputComponents...), nil
+}
+
+func scrapePackage(pres *godoc.Presentation, moduleRoot, packagePath, outputPath, baseURL string) error {
+	outputPath, err := packageOutputPath(moduleRoot, packagePath, outputPath)
+	if err != nil {
+		return err
+	}
 
 	page, err := getPage(pres, path.Join("/pkg", packagePath)+"/")
 	if err != nil {
 		return err
 	}
+	page = bytes.Replace(page, []byte("</body>"), []byte(searchWidgetHTML(baseURL)+"</body>"), 1)
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0700); err != nil {
 		return err
 	}
 	return ioutil.WriteFile(outputPath, page, 0600)
 }
 
-func readTemplates(args Args, pres *godoc.Presentation, fs vfs.FileSystem) {
+func readTemplates(args Args, pres *godoc.Presentation, fs vfs.FileSystem, theme themeAssets) {
 	funcs := pres.FuncMap()
-	addGoPagesFuncs(funcs, args)
+	addGoPagesFuncs(funcs, args, theme)
 	pres.CallGraphHTML = readTemplate(funcs, fs, "callgraph.html")
 	pres.DirlistHTML = readTemplate(funcs, fs, "dirlist.html")
 	pres.ErrorHTML = readTemplate(funcs, fs, "error.html")
 	pres.ExampleHTML = readTemplate(funcs, fs, "example.html")
-	pres.GodocHTML = parseTemplate(funcs, "godoc.html", godocHTML)
+	pres.GodocHTML = parseTemplate(funcs, "godoc.html", composeGodocHTML(theme))
 	pres.ImplementsHTML = readTemplate(funcs, fs, "implements.html")
 	pres.MethodSetHTML = readTemplate(funcs, fs, "methodset.html")
 	pres.PackageHTML = readTemplate(funcs, fs, "package.html")
 	pres.PackageRootHTML = readTemplate(funcs, fs, "packageroot.html")
 }
 
+// composeGodocHTML injects the theme's head and footer fragments into the
+// page chrome shared by every generated page.
+func composeGodocHTML(theme themeAssets) string {
+	data := strings.Replace(godocHTML, "</head>", theme.Head+"</head>", 1)
+	data = strings.Replace(data, "</body>", theme.Footer+"</body>", 1)
+	return data
+}
+
 func readTemplate(funcs template.FuncMap, fs vfs.FileSystem, name string) *template.Template {
 	// use underlying file system fs to read the template file
 	// (cannot use template ParseFile functions directly)
@@ -259,7 +319,7 @@ window.location = {{.URL}}
 	return buf.String()
 }
 
-func addGoPagesFuncs(funcs template.FuncMap, args Args) {
+func addGoPagesFuncs(funcs template.FuncMap, args Args, theme themeAssets) {
 	var longTitle string
 	if args.SiteTitle != "" && args.SiteDescription != "" {
 		longTitle = fmt.Sprintf("%s | %s", args.SiteTitle, args.SiteDescription)
@@ -286,5 +346,8 @@ func addGoPagesFuncs(funcs template.FuncMap, args Args) {
 		}
 		return defaultValue, nil
 	}
+	funcs["gopagesThemed"] = func() bool {
+		return args.ThemePath != ""
+	}
 
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/godoc"
+)
+
+// manifestFileName is written to OutputPath at the end of every run. In
+// incremental mode it records the hash that produced each package's page so
+// unchanged packages can skip regeneration on the next run; other runs leave
+// its package list empty.
+const manifestFileName = ".gopages-manifest.json"
+
+type buildManifest struct {
+	TemplatesHash string            `json:"templatesHash"`
+	Packages      map[string]string `json:"packages"`
+}
+
+func loadManifest(outputPath string) buildManifest {
+	manifest := buildManifest{Packages: make(map[string]string)}
+	buf, err := ioutil.ReadFile(filepath.Join(outputPath, manifestFileName))
+	if err != nil {
+		return manifest
+	}
+	_ = json.Unmarshal(buf, &manifest) // best effort; a corrupt manifest just forces a full rebuild
+	if manifest.Packages == nil {
+		manifest.Packages = make(map[string]string)
+	}
+	return manifest
+}
+
+func saveManifest(outputPath string, manifest buildManifest) error {
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outputPath, manifestFileName), buf, 0600)
+}
+
+// templatesHash summarizes the templates and theme content shared by every
+// page, so a template or theme edit invalidates the whole cache. Flag values
+// such as -base, -brand-title and -brand-description are not part of the
+// hash, so changing only those does not invalidate cached pages. This
+// must cover every static.Files entry a -theme directory can override
+// (including the page templates readTemplates loads, like package.html and
+// dirlist.html), not just the assets the browser fetches directly.
+func templatesHash(theme themeAssets) string {
+	h := sha256.New()
+	fmt.Fprint(h, composeGodocHTML(theme))
+	fmt.Fprint(h, theme.Head, theme.Footer)
+
+	files := theme.mergedFiles()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprint(h, name, files[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// packageSourceHash hashes the path, size and mtime of each of a package's Go
+// files (not their contents), so edits to its source (but not unrelated
+// packages) invalidate its cache.
+func packageSourceHash(modulePackage, packagePath string) (string, error) {
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles,
+	}, packagePath)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, pkg := range pkgs {
+		for _, file := range pkg.GoFiles {
+			info, err := os.Stat(file)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s:%d:%d\n", file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// scrapePackages renders every package page in paths, fanning the work out
+// across a bounded pool of jobs workers. In incremental mode, packages whose
+// source and template hash haven't changed since the previous run, and whose
+// page already exists on disk, are skipped.
+func scrapePackages(pres *godoc.Presentation, modulePackage string, paths []string, outputPath, baseURL string, jobs int, incremental bool, prevManifest, newManifest buildManifest) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	pathCh := make(chan string)
+	errCh := make(chan error, len(paths))
+	var manifestMu sync.Mutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for packagePath := range pathCh {
+				if err := scrapeOnePackage(pres, modulePackage, packagePath, outputPath, baseURL, incremental, prevManifest, newManifest, &manifestMu); err != nil {
+					errCh <- err
+				}
+			}
+		}()
+	}
+
+	for _, packagePath := range paths {
+		pathCh <- packagePath
+	}
+	close(pathCh)
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scrapeOnePackage(pres *godoc.Presentation, modulePackage, packagePath, outputPath, baseURL string, incremental bool, prevManifest, newManifest buildManifest, manifestMu *sync.Mutex) error {
+	if !incremental {
+		return scrapePackage(pres, modulePackage, packagePath, outputPath, baseURL)
+	}
+
+	hash, err := packageSourceHash(modulePackage, packagePath)
+	if err != nil {
+		return err
+	}
+	combined := hash + "|" + newManifest.TemplatesHash
+
+	pagePath, err := packageOutputPath(modulePackage, packagePath, outputPath)
+	if err != nil {
+		return err
+	}
+	if prevManifest.Packages[packagePath] == combined {
+		if _, err := os.Stat(pagePath); err == nil {
+			manifestMu.Lock()
+			newManifest.Packages[packagePath] = combined
+			manifestMu.Unlock()
+			return nil
+		}
+	}
+
+	if err := scrapePackage(pres, modulePackage, packagePath, outputPath, baseURL); err != nil {
+		return err
+	}
+	manifestMu.Lock()
+	newManifest.Packages[packagePath] = combined
+	manifestMu.Unlock()
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/doc"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// SearchEntry is a single identifier occurrence recorded in the client-side
+// search index, enough to link directly to its documentation anchor.
+type SearchEntry struct {
+	Package string `json:"package"`
+	Kind    string `json:"kind"`
+	Anchor  string `json:"anchor"`
+}
+
+// SearchIndex maps an exported identifier to every package where it occurs,
+// forming the inverted index consumed by search.js in the browser.
+type SearchIndex map[string][]SearchEntry
+
+func buildSearchIndex(modulePackage string, paths []string) (SearchIndex, error) {
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo,
+	}, modulePackage+"/...")
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]*packages.Package, len(pkgs))
+	for _, pkg := range pkgs {
+		byPath[pkg.PkgPath] = pkg
+	}
+
+	index := make(SearchIndex)
+	for _, pkgPath := range paths {
+		pkg, ok := byPath[pkgPath]
+		if !ok {
+			continue
+		}
+		docPkg, err := doc.NewFromFiles(pkg.Fset, pkg.Syntax, pkgPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to extract doc for package %q", pkgPath)
+		}
+		for _, f := range docPkg.Funcs {
+			index.add(f.Name, pkgPath, "func", "#"+f.Name)
+		}
+		for _, t := range docPkg.Types {
+			index.add(t.Name, pkgPath, "type", "#"+t.Name)
+			for _, m := range t.Methods {
+				index.add(m.Name, pkgPath, "method", fmt.Sprintf("#%s.%s", t.Name, m.Name))
+			}
+			for _, f := range t.Funcs {
+				index.add(f.Name, pkgPath, "func", "#"+f.Name)
+			}
+		}
+		for _, v := range docPkg.Vars {
+			for _, name := range v.Names {
+				index.add(name, pkgPath, "var", "#"+name)
+			}
+		}
+		for _, c := range docPkg.Consts {
+			for _, name := range c.Names {
+				index.add(name, pkgPath, "const", "#"+name)
+			}
+		}
+	}
+	return index, nil
+}
+
+func (index SearchIndex) add(identifier, pkgPath, kind, anchor string) {
+	index[identifier] = append(index[identifier], SearchEntry{
+		Package: pkgPath,
+		Kind:    kind,
+		Anchor:  anchor,
+	})
+}
+
+// writeSearchAssets writes the search index accumulated across every module
+// plus the static search.js/search.html assets. Callers generating a
+// workspace of multiple modules should merge each module's buildSearchIndex
+// result and call this once, after the last module, so earlier modules'
+// identifiers aren't overwritten by later ones.
+func writeSearchAssets(args Args, index SearchIndex) error {
+	buf, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(args.OutputPath, "search-index.json"), buf, 0600); err != nil {
+		return err
+	}
+
+	searchJSPath := filepath.Join(args.OutputPath, "lib", "godoc", "search.js")
+	if err := ioutil.WriteFile(searchJSPath, []byte(searchJS), 0600); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(args.OutputPath, "search.html"), []byte(fmt.Sprintf(searchHTML, joinURL(args.BaseURL, "lib/godoc/search.js"))), 0600)
+}
+
+// searchWidgetHTML is injected before the closing </body> tag of every
+// generated package page, giving in-page access to the site-wide search box.
+// baseURL must be the same -base value the rest of the site was generated
+// with, so the script resolves under subpath deployments (e.g. GitHub Pages
+// project sites) instead of always pointing at the site root.
+func searchWidgetHTML(baseURL string) string {
+	return fmt.Sprintf(searchWidgetTemplate, joinURL(baseURL, "lib/godoc/search.js"))
+}
+
+const searchWidgetTemplate = `
+<div id="gopages-search-widget">
+	<input type="text" id="gopages-search-input" placeholder="Search identifiers...">
+	<ul id="gopages-search-results"></ul>
+</div>
+<script src="%s" defer></script>
+`
+
+// searchHTML is the standalone search page, matching a typed query against
+// every exported identifier in the site with exact/prefix matching and kind
+// filters.
+const searchHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Search</title>
+</head>
+<body>
+<h1>Search</h1>
+<input type="text" id="gopages-search-input" placeholder="Search identifiers... (try kind:func name)">
+<ul id="gopages-search-results"></ul>
+<script src="%s" defer></script>
+</body>
+</html>
+`
+
+// searchJS implements fully client-side lookups against search-index.json:
+// exact and prefix matches over identifiers, optional "kind:" filtering, and
+// navigation straight to the matching package's #Name anchor.
+const searchJS = `
+(function () {
+	// Captured once, synchronously, since document.currentScript is only set
+	// while this script is the one executing; it reflects wherever the page
+	// actually loaded search.js from, so it already accounts for -base.
+	var siteRoot = resolveSiteRoot();
+	var indexPromise = fetch(siteRoot + 'search-index.json')
+		.then(function (resp) { return resp.json(); });
+
+	function resolveSiteRoot() {
+		var script = document.currentScript;
+		return script ? script.src.replace(/lib\/godoc\/search\.js.*$/, '') : '/';
+	}
+
+	function parseQuery(raw) {
+		var kind = '';
+		var term = raw.trim();
+		var match = term.match(/^kind:(\S+)\s*(.*)$/i);
+		if (match) {
+			kind = match[1].toLowerCase();
+			term = match[2];
+		}
+		return { kind: kind, term: term.toLowerCase() };
+	}
+
+	function search(index, query) {
+		var results = [];
+		if (!query.term) {
+			return results;
+		}
+		Object.keys(index).forEach(function (identifier) {
+			var lower = identifier.toLowerCase();
+			var matches = lower === query.term || lower.indexOf(query.term) === 0;
+			if (!matches) {
+				return;
+			}
+			index[identifier].forEach(function (entry) {
+				if (query.kind && entry.kind !== query.kind) {
+					return;
+				}
+				results.push({ identifier: identifier, entry: entry });
+			});
+		});
+		results.sort(function (a, b) { return a.identifier.localeCompare(b.identifier); });
+		return results;
+	}
+
+	function render(list, results) {
+		list.innerHTML = '';
+		results.forEach(function (result) {
+			var li = document.createElement('li');
+			var a = document.createElement('a');
+			a.href = siteRoot + 'pkg/' + result.entry.package + '/' + result.entry.anchor;
+			a.textContent = result.identifier + ' (' + result.entry.kind + ', ' + result.entry.package + ')';
+			li.appendChild(a);
+			list.appendChild(li);
+		});
+	}
+
+	document.addEventListener('DOMContentLoaded', function () {
+		var input = document.getElementById('gopages-search-input');
+		var list = document.getElementById('gopages-search-results');
+		if (!input || !list) {
+			return;
+		}
+		input.addEventListener('input', function () {
+			indexPromise.then(function (index) {
+				render(list, search(index, parseQuery(input.value)));
+			});
+		});
+	});
+})();
+`
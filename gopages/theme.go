@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"golang.org/x/tools/godoc/static"
+)
+
+// themeAssets holds the resolved theming content for a single run: the head
+// and footer fragments composed into every generated page, plus any
+// static.Files entries a -theme directory wants to override.
+type themeAssets struct {
+	Head      string
+	Footer    string
+	Overrides map[string]string
+}
+
+// loadTheme reads a -theme directory, if any, and layers it over the
+// built-in dark-mode-aware defaults. Any file in themePath whose name
+// matches a static.Files entry overrides that entry; "head.html" and
+// "footer.html" instead override the chrome fragments composed into
+// godoc.html.
+func loadTheme(themePath string) (themeAssets, error) {
+	assets := themeAssets{
+		Head:      builtinHeadHTML,
+		Footer:    builtinFooterHTML,
+		Overrides: make(map[string]string),
+	}
+	if themePath == "" {
+		return assets, nil
+	}
+
+	files, err := ioutil.ReadDir(themePath)
+	if err != nil {
+		return themeAssets{}, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(themePath, file.Name()))
+		if err != nil {
+			return themeAssets{}, err
+		}
+		switch file.Name() {
+		case "head.html":
+			assets.Head = string(buf)
+		case "footer.html":
+			assets.Footer = string(buf)
+		default:
+			assets.Overrides[file.Name()] = string(buf)
+		}
+	}
+	return assets, nil
+}
+
+// mergedFiles returns static.Files with theme.Overrides layered on top, so
+// the vfs bind used for template rendering and the on-disk asset copy both
+// see the same, themed content.
+func (theme themeAssets) mergedFiles() map[string]string {
+	files := make(map[string]string, len(static.Files))
+	for name, content := range static.Files {
+		files[name] = content
+	}
+	for name, content := range theme.Overrides {
+		files[name] = content
+	}
+	return files
+}
+
+// builtinHeadHTML toggles a dark theme via prefers-color-scheme, overridable
+// by a persisted localStorage choice so a reader's toggle sticks across
+// pages. The "data-gopages-theme" attribute is set on <html> (not <body>,
+// which doesn't exist yet while <head> runs) as soon as the stored choice is
+// known, so the page never flashes the wrong theme before builtinFooterHTML
+// runs.
+const builtinHeadHTML = `
+<style>
+@media (prefers-color-scheme: dark) {
+	html:not([data-gopages-theme="light"]) body {
+		background: #1e1e1e;
+		color: #ddd;
+	}
+	html:not([data-gopages-theme="light"]) a {
+		color: #8ab4f8;
+	}
+}
+html[data-gopages-theme="dark"] body {
+	background: #1e1e1e;
+	color: #ddd;
+}
+html[data-gopages-theme="dark"] a {
+	color: #8ab4f8;
+}
+</style>
+<script>
+(function () {
+	var stored = localStorage.getItem("gopages-theme");
+	if (stored) {
+		document.documentElement.setAttribute("data-gopages-theme", stored);
+	}
+})();
+</script>
+`
+
+// builtinFooterHTML renders the dark mode toggle button and persists the
+// reader's choice to localStorage, applying it to the same
+// "data-gopages-theme" attribute on <html> that builtinHeadHTML and its CSS
+// check.
+const builtinFooterHTML = `
+<button id="gopages-theme-toggle" aria-label="Toggle dark mode">&#9680;</button>
+<script>
+(function () {
+	var button = document.getElementById("gopages-theme-toggle");
+	if (!button) {
+		return;
+	}
+	function apply(theme) {
+		document.documentElement.setAttribute("data-gopages-theme", theme);
+	}
+	button.addEventListener("click", function () {
+		var next = document.documentElement.getAttribute("data-gopages-theme") === "dark" ? "light" : "dark";
+		localStorage.setItem("gopages-theme", next);
+		apply(next);
+	});
+})();
+</script>
+`
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/doc"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/godoc"
+)
+
+// module describes a single Go module to document, either the lone module
+// in the current directory or one `use`d by a go.work workspace file.
+type module struct {
+	Path string // module package path, e.g. github.com/example/foo
+	Dir  string // absolute directory containing the module's go.mod
+}
+
+// discoverModules finds every module to document rooted at workDir. If a
+// go.work file is present, every module it `use`s is returned. Otherwise,
+// workDir itself must contain a single go.mod.
+func discoverModules(workDir string) ([]module, error) {
+	workFile := filepath.Join(workDir, "go.work")
+	if _, err := os.Stat(workFile); err == nil {
+		return parseWorkspace(workDir, workFile)
+	}
+
+	goMod := filepath.Join(workDir, "go.mod")
+	if _, err := os.Stat(goMod); os.IsNotExist(err) {
+		return nil, errors.New("go.mod not found in the current directory")
+	}
+	modulePackage, err := modulePathFromGoMod(goMod)
+	if err != nil {
+		return nil, err
+	}
+	return []module{{Path: modulePackage, Dir: workDir}}, nil
+}
+
+func parseWorkspace(workDir, workFile string) ([]module, error) {
+	buf, err := ioutil.ReadFile(workFile)
+	if err != nil {
+		return nil, err
+	}
+	wf, err := modfile.ParseWork(workFile, buf, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make([]module, 0, len(wf.Use))
+	for _, use := range wf.Use {
+		dir := filepath.Join(workDir, use.Path)
+		modulePackage, err := modulePathFromGoMod(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, module{Path: modulePackage, Dir: dir})
+	}
+	return modules, nil
+}
+
+func modulePathFromGoMod(goMod string) (string, error) {
+	buf, err := ioutil.ReadFile(goMod)
+	if err != nil {
+		return "", err
+	}
+	modulePackage := modfile.ModulePath(buf)
+	if modulePackage == "" {
+		return "", errors.Errorf("Unable to find module package name in go.mod file: %s", goMod)
+	}
+	return modulePackage, nil
+}
+
+// moduleSynopsis returns the doc comment synopsis of the package at a
+// module's root, or an empty string if it has none.
+func moduleSynopsis(modulePackage string) (string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedSyntax,
+		Fset: fset,
+	}, modulePackage)
+	if err != nil {
+		return "", err
+	}
+	if len(pkgs) == 0 || len(pkgs[0].Syntax) == 0 {
+		return "", nil
+	}
+	docPkg, err := doc.NewFromFiles(fset, pkgs[0].Syntax, modulePackage)
+	if err != nil {
+		return "", nil
+	}
+	return doc.Synopsis(docPkg.Doc), nil
+}
+
+// writeWorkspaceLandingPage writes a top-level index.html listing every
+// module in the workspace, in place of the usual single-module redirect.
+func writeWorkspaceLandingPage(pres *godoc.Presentation, args Args, modules []module) error {
+	var body bytes.Buffer
+	body.WriteString("<h1>Modules</h1>\n<ul>\n")
+	for _, mod := range modules {
+		synopsis, err := moduleSynopsis(mod.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&body, "<li><a href=\"%s\">%s</a>%s</li>\n",
+			joinURL(args.BaseURL, "pkg", mod.Path)+"/",
+			template.HTMLEscapeString(mod.Path),
+			synopsisSuffix(synopsis),
+		)
+	}
+	body.WriteString("</ul>\n")
+
+	page, err := genericPage(pres, "Modules", body.String())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(args.OutputPath, "index.html"), page, 0600)
+}
+
+func synopsisSuffix(synopsis string) string {
+	if synopsis == "" {
+		return ""
+	}
+	return " &mdash; " + template.HTMLEscapeString(synopsis)
+}